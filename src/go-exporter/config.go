@@ -0,0 +1,43 @@
+// src/go-exporter/config.go
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AuthModule describes the credentials and connection parameters used to
+// reach one class of target database. Auth modules are referenced by name
+// from a probe request (e.g. "?auth_module=rds_prod") so that usernames and
+// passwords never have to be passed around in URLs or scrape configs.
+type AuthModule struct {
+	Username string            `yaml:"username"`
+	Password string            `yaml:"password"`
+	SSLMode  string            `yaml:"sslmode"`
+	Params   map[string]string `yaml:"params"`
+}
+
+// Config is the top-level shape of the exporter's -config.file: auth
+// modules for the /probe endpoint, plus the set of user-defined queries run
+// against the exporter's own target database.
+type Config struct {
+	AuthModules map[string]AuthModule `yaml:"auth_modules"`
+	Queries     []QueryDef            `yaml:"queries"`
+}
+
+// LoadConfig reads and parses the YAML config file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file %q: %w", path, err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing config file %q: %w", path, err)
+	}
+
+	return &cfg, nil
+}
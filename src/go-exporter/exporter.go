@@ -2,11 +2,16 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	// PostgreSQL driver
@@ -25,22 +30,71 @@ var (
 	dbName = os.Getenv("DB_NAME")
 	// ---------------------
 
-	// Define a Prometheus Gauge metric. A Gauge is a metric that represents
-	// a single numerical value that can arbitrarily go up and down.
-	processedMessagesTotal = prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "processed_messages_total",
-		Help: "The total number of processed messages in the database.",
-	})
+	// configFile points at the YAML file describing /probe auth modules and
+	// user-defined queries.
+	configFile = flag.String("config.file", "", "Path to the exporter's config file (auth modules and queries). If unset, /probe is disabled and no queries run.")
+
+	// --- CONNECTION POOL TUNING ---
+	// These let operators size the pool for their environment without a
+	// code change; see applyPoolSettings for the defaults used when unset.
+	dbMaxOpenConns    = os.Getenv("DB_MAX_OPEN_CONNS")
+	dbMaxIdleConns    = os.Getenv("DB_MAX_IDLE_CONNS")
+	dbConnMaxLifetime = os.Getenv("DB_CONN_MAX_LIFETIME")
+	// -------------------------------
 )
 
 func init() {
 	// Configure the logger to include the date, time, and file name.
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	// Register the metric with the Prometheus client library's default registry.
-	prometheus.MustRegister(processedMessagesTotal)
+}
+
+// applyPoolSettings tunes db's connection pool from the DB_MAX_OPEN_CONNS,
+// DB_MAX_IDLE_CONNS, and DB_CONN_MAX_LIFETIME environment variables,
+// falling back to database/sql's own defaults for any that are unset or
+// unparsable.
+func applyPoolSettings(db *sql.DB) {
+	if dbMaxOpenConns != "" {
+		if n, err := strconv.Atoi(dbMaxOpenConns); err == nil {
+			db.SetMaxOpenConns(n)
+		} else {
+			log.Printf("WARNING: invalid DB_MAX_OPEN_CONNS %q, ignoring: %v", dbMaxOpenConns, err)
+		}
+	}
+	if dbMaxIdleConns != "" {
+		if n, err := strconv.Atoi(dbMaxIdleConns); err == nil {
+			db.SetMaxIdleConns(n)
+		} else {
+			log.Printf("WARNING: invalid DB_MAX_IDLE_CONNS %q, ignoring: %v", dbMaxIdleConns, err)
+		}
+	}
+	if dbConnMaxLifetime != "" {
+		if d, err := time.ParseDuration(dbConnMaxLifetime); err == nil {
+			db.SetConnMaxLifetime(d)
+		} else {
+			log.Printf("WARNING: invalid DB_CONN_MAX_LIFETIME %q, ignoring: %v", dbConnMaxLifetime, err)
+		}
+	}
 }
 
 func main() {
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Set up OpenTelemetry tracing (if OTEL_EXPORTER_OTLP_ENDPOINT is set) so
+	// query duration exemplars can carry a real trace_id.
+	shutdownTracing, err := initTracing(ctx)
+	if err != nil {
+		log.Printf("WARNING: could not initialize OpenTelemetry tracing, exemplars will be omitted: %v", err)
+		shutdownTracing = func(context.Context) error { return nil }
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Printf("WARNING: error shutting down tracing: %v", err)
+		}
+	}()
+
 	// Log the configuration variables for debugging purposes.
 	// IMPORTANT: Never log passwords or other secrets.
 	log.Println("--- Go Exporter Starting Up ---")
@@ -59,44 +113,79 @@ func main() {
 	// Use sslmode=require for connecting to cloud-based databases like RDS.
 	connStr := fmt.Sprintf("host=%s user=%s password=%s dbname=%s sslmode=require", dbHost, dbUser, dbPass, dbName)
 
-	// Open a connection to the database.
+	// Open a connection to the database, retrying with backoff instead of
+	// exiting on a transient connectivity hiccup at boot.
 	log.Println("Attempting to connect to the database...")
-	db, err := sql.Open("postgres", connStr)
+	db, err := connectWithBackoff(ctx, connStr)
 	if err != nil {
-		log.Fatalf("FATAL: Error creating database connection pool: %v", err)
+		log.Fatalf("FATAL: Could not connect to the database before shutdown was requested: %v", err)
 	}
 	defer db.Close()
+	log.Println("✅ Database connection successful.")
 
-	// Ping the database to verify the connection is alive.
-	err = db.Ping()
-	if err != nil {
-		log.Fatalf("FATAL: Could not ping the database. Please check connection details and network access. Error: %v", err)
+	// Keep watching the connection for the life of the process, reconnecting
+	// with backoff whenever a ping fails instead of serving off a dead pool.
+	go db.monitor(ctx)
+
+	// Register connection pool stats (open/in-use/idle connections, wait
+	// counts, etc.) so pool health is visible alongside the query metrics below.
+	prometheus.MustRegister(&dbStatsCollector{h: db, dbName: dbName})
+
+	// Load the config file, if any, and start one query collector goroutine
+	// per entry under "queries". This replaces what used to be a single
+	// hardcoded SELECT COUNT(*) query with an arbitrary, operator-defined set.
+	var cfg *Config
+	if *configFile != "" {
+		cfg, err = LoadConfig(*configFile)
+		if err != nil {
+			log.Fatalf("FATAL: Could not load config file: %v", err)
+		}
 	}
-	log.Println("✅ Database connection successful.")
 
-	// Start a background goroutine to periodically query the database.
-	log.Println("Starting background routine for periodic database queries...")
-	go func() {
-		for {
-			log.Println("Querying for total processed messages...")
-			var count int
-			// Query the database for the total count of messages.
-			err := db.QueryRow("SELECT COUNT(*) FROM processed_messages").Scan(&count)
+	if cfg != nil && len(cfg.Queries) > 0 {
+		log.Printf("Loaded %d configured queries from %s", len(cfg.Queries), *configFile)
+		for _, def := range cfg.Queries {
+			qc, err := newQueryCollector(def, db)
 			if err != nil {
-				log.Printf("ERROR: Database query failed: %v", err)
-			} else {
-				// If the query is successful, update the Prometheus gauge.
-				processedMessagesTotal.Set(float64(count))
-				log.Printf("-> Found %d processed messages. Metric updated.", count)
+				log.Fatalf("FATAL: invalid query %q in config file: %v", def.Name, err)
 			}
-			// Wait for 30 seconds before the next query.
-			log.Println("Waiting for 30 seconds until next query...")
-			time.Sleep(30 * time.Second)
+			prometheus.MustRegister(qc)
+			go qc.Run(ctx)
+		}
+	} else {
+		log.Println("No queries configured; only pool stats will be exported. See -config.file.")
+	}
+
+	mux := http.NewServeMux()
+	// EnableOpenMetrics so the duration histogram's exemplars (trace IDs) are
+	// actually emitted; the plain Prometheus exposition format drops them.
+	mux.Handle("/metrics", promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", db.readyzHandler)
+
+	// If auth modules were supplied, also expose /probe so a single exporter
+	// instance can scrape arbitrary Postgres targets (e.g. many RDS
+	// instances) on demand, each with its own fresh registry.
+	if cfg != nil && len(cfg.AuthModules) > 0 {
+		log.Printf("Loaded %d auth module(s) from %s, enabling /probe", len(cfg.AuthModules), *configFile)
+		mux.Handle("/probe", probeHandler(cfg, newDBCache(ctx)))
+	}
+
+	srv := &http.Server{Addr: ":8080", Handler: mux}
+	go func() {
+		log.Println("Starting metrics server on :8080")
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("FATAL: metrics server error: %v", err)
 		}
 	}()
 
-	// Expose the registered metrics on the /metrics endpoint.
-	log.Println("Starting metrics server on :8080/metrics")
-	http.Handle("/metrics", promhttp.Handler())
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	<-ctx.Done()
+	log.Println("Shutdown signal received, draining in-flight requests...")
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("WARNING: error shutting down metrics server: %v", err)
+	}
 }
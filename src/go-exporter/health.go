@@ -0,0 +1,188 @@
+// src/go-exporter/health.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+var (
+	pingInterval = flag.Duration("ping-interval", 10*time.Second, "How often to ping the database to check liveness.")
+	readyzMaxAge = flag.Duration("readyz-max-age", 30*time.Second, "/readyz fails once this long has passed since the last successful ping.")
+)
+
+// querier is the subset of *sql.DB used by query collectors and the probe
+// handler. dbHandle implements it by delegating to whichever *sql.DB is
+// currently live, so callers keep working across a reconnect.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// dbHandle holds the exporter's connection to its own target database and
+// knows how to replace it in place after repeated ping failures, so a
+// transient outage never leaves the exporter stuck with a dead pool.
+type dbHandle struct {
+	connStr string
+
+	mu sync.RWMutex
+	db *sql.DB
+
+	lastPingSuccess atomic.Int64 // unix seconds
+}
+
+// connectWithBackoff opens connStr and retries with exponential backoff
+// (capped at 30s) until the first successful ping or ctx is done. This
+// replaces the old behavior of log.Fatalf on the very first ping, which
+// killed the container on any transient connectivity hiccup at boot.
+func connectWithBackoff(ctx context.Context, connStr string) (*dbHandle, error) {
+	backoff := time.Second
+	const maxBackoff = 30 * time.Second
+
+	for attempt := 1; ; attempt++ {
+		db, err := sql.Open("postgres", connStr)
+		if err == nil {
+			applyPoolSettings(db)
+			err = db.PingContext(ctx)
+		}
+		if err == nil {
+			h := &dbHandle{connStr: connStr, db: db}
+			h.lastPingSuccess.Store(time.Now().Unix())
+			return h, nil
+		}
+		if db != nil {
+			db.Close()
+		}
+		log.Printf("WARNING: could not connect to database (attempt %d): %v; retrying in %s", attempt, err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (h *dbHandle) current() *sql.DB {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.db
+}
+
+func (h *dbHandle) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return h.current().QueryContext(ctx, query, args...)
+}
+
+func (h *dbHandle) Close() error {
+	return h.current().Close()
+}
+
+// reconnect closes the current pool and opens a fresh one against the same
+// connStr, retrying with exponential backoff until it succeeds or ctx is done.
+func (h *dbHandle) reconnect(ctx context.Context) {
+	backoff := time.Second
+	const maxBackoff = 30 * time.Second
+
+	for attempt := 1; ; attempt++ {
+		db, err := sql.Open("postgres", h.connStr)
+		if err == nil {
+			applyPoolSettings(db)
+			err = db.PingContext(ctx)
+		}
+		if err == nil {
+			h.mu.Lock()
+			old := h.db
+			h.db = db
+			h.mu.Unlock()
+			old.Close()
+			h.lastPingSuccess.Store(time.Now().Unix())
+			log.Printf("Reconnected to database after %d attempt(s).", attempt)
+			return
+		}
+		if db != nil {
+			db.Close()
+		}
+		log.Printf("WARNING: reconnect attempt %d failed: %v; retrying in %s", attempt, err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// monitor pings the database on a ticker for as long as ctx is live,
+// reconnecting once a ping fails. It's the thing that notices a wedged pool
+// and acts on it, instead of the exporter quietly serving stale metrics.
+func (h *dbHandle) monitor(ctx context.Context) {
+	ticker := time.NewTicker(*pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := h.current().PingContext(ctx); err != nil {
+				log.Printf("WARNING: database ping failed: %v; reconnecting", err)
+				h.reconnect(ctx)
+				continue
+			}
+			h.lastPingSuccess.Store(time.Now().Unix())
+		}
+	}
+}
+
+// dbStatsCollector exposes the pool stats (open/in-use/idle connections,
+// wait counts, etc.) of whichever *sql.DB is currently live behind h, so the
+// exported metrics survive a reconnect instead of freezing on the old pool.
+type dbStatsCollector struct {
+	h      *dbHandle
+	dbName string
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	collectors.NewDBStatsCollector(c.h.current(), c.dbName).Describe(ch)
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	collectors.NewDBStatsCollector(c.h.current(), c.dbName).Collect(ch)
+}
+
+// healthzHandler always reports OK once the process is up: it's a liveness
+// check, not a dependency check.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "ok")
+}
+
+// readyzHandler reports OK only if the database was pinged successfully
+// within readyzMaxAge, so orchestrators can stop routing scrapes to an
+// exporter whose DB connection has gone stale.
+func (h *dbHandle) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	age := time.Since(time.Unix(h.lastPingSuccess.Load(), 0))
+	if age > *readyzMaxAge {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "not ready: last successful ping was %s ago\n", age.Round(time.Second))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "ok")
+}
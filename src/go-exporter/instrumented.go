@@ -0,0 +1,71 @@
+// src/go-exporter/instrumented.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// slowSQLThreshold is the duration above which a query logs a warning. A
+// value of zero or less disables slow-query logging entirely.
+var slowSQLThreshold = flag.Duration("slow-sql-threshold", time.Second, "Log a warning when a query takes longer than this. <= 0 disables slow-query logging.")
+
+var (
+	queryDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "telemetryhub_query_duration_seconds",
+		Help: "Duration of queries run by the exporter, labeled by query name.",
+	}, []string{"query"})
+
+	queryErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "telemetryhub_query_errors_total",
+		Help: "Total number of query errors, labeled by query name and Postgres SQLSTATE code.",
+	}, []string{"query", "sqlstate"})
+)
+
+func init() {
+	prometheus.MustRegister(queryDurationSeconds, queryErrorsTotal)
+}
+
+// sqlState extracts the Postgres SQLSTATE code from err, or "unknown" if err
+// isn't a *pq.Error.
+func sqlState(err error) string {
+	if pqErr, ok := err.(*pq.Error); ok {
+		return string(pqErr.Code)
+	}
+	return "unknown"
+}
+
+// recordQuery updates the duration histogram and, on error, the error
+// counter for the named query, and logs a warning if it ran slower than
+// -slow-sql-threshold. When traceID is non-empty, the observation carries it
+// as an exemplar so a latency spike in Grafana can link through to the trace.
+func recordQuery(name string, d time.Duration, err error, traceID string) {
+	obs := queryDurationSeconds.WithLabelValues(name)
+	if exObs, ok := obs.(prometheus.ExemplarObserver); ok && traceID != "" {
+		exObs.ObserveWithExemplar(d.Seconds(), prometheus.Labels{"trace_id": traceID})
+	} else {
+		obs.Observe(d.Seconds())
+	}
+	if err != nil {
+		queryErrorsTotal.WithLabelValues(name, sqlState(err)).Inc()
+	}
+	if *slowSQLThreshold > 0 && d > *slowSQLThreshold {
+		log.Printf("WARNING: slow query %q took %s (threshold %s)", name, d, *slowSQLThreshold)
+	}
+}
+
+// instrumentedQuery runs db.QueryContext while recording its duration and,
+// on failure, its error, against the named query. Pass traceID from the
+// current span to attach an exemplar, or "" to skip it.
+func instrumentedQuery(ctx context.Context, db querier, name, query, traceID string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := db.QueryContext(ctx, query, args...)
+	recordQuery(name, time.Since(start), err, traceID)
+	return rows, err
+}
@@ -0,0 +1,313 @@
+// src/go-exporter/probe.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	probeMaxTargets  = flag.Int("probe.max-cached-targets", 100, "Maximum number of distinct /probe targets to keep a connection pool open for; the least recently used is evicted beyond this.")
+	probeTargetTTL   = flag.Duration("probe.target-idle-ttl", 10*time.Minute, "Close a /probe target's connection pool after it hasn't been scraped for this long.")
+	probeDialTimeout = flag.Duration("probe.connect-timeout", 10*time.Second, "Maximum time to wait for a new or cached connection to a probe target to answer a ping.")
+)
+
+// dbCache keeps one *sql.DB per (target, auth_module) pair alive across
+// scrapes, since opening a fresh connection on every probe would be far too
+// slow for Prometheus's scrape timeouts. Since "target" is caller-supplied,
+// entries are bounded by both an idle TTL and a max count (LRU-evicted) so a
+// scraper that varies target on every request can't leak one pool per
+// request forever.
+//
+// mu guards only the map itself (which entries exist). Each entry has its
+// own mutex guarding the slow part (dialing/pinging that one target), so one
+// unreachable target blocking on a TCP timeout can't stall every other
+// target's /probe scrape the way a single cache-wide lock would.
+type dbCache struct {
+	mu  sync.Mutex
+	dbs map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	mu sync.Mutex // guards db; held only while (re)connecting this one target
+	db *sql.DB
+
+	lastUsed atomic.Int64 // unix nanos; read lock-free by the LRU/TTL sweeps
+}
+
+func newDBCache(ctx context.Context) *dbCache {
+	c := &dbCache{dbs: make(map[string]*cacheEntry)}
+	go c.evictLoop(ctx)
+	return c
+}
+
+// evictLoop periodically closes and drops any entry idle for longer than
+// -probe.target-idle-ttl, until ctx is done.
+func (c *dbCache) evictLoop(ctx context.Context) {
+	interval := *probeTargetTTL / 2
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.evictIdle()
+		}
+	}
+}
+
+func (c *dbCache) evictIdle() {
+	now := time.Now()
+
+	c.mu.Lock()
+	snapshot := make(map[string]*cacheEntry, len(c.dbs))
+	for key, entry := range c.dbs {
+		snapshot[key] = entry
+	}
+	c.mu.Unlock()
+
+	for key, entry := range snapshot {
+		if now.Sub(time.Unix(0, entry.lastUsed.Load())) <= *probeTargetTTL {
+			continue
+		}
+		c.mu.Lock()
+		delete(c.dbs, key)
+		c.mu.Unlock()
+
+		entry.mu.Lock()
+		if entry.db != nil {
+			entry.db.Close()
+		}
+		entry.mu.Unlock()
+	}
+}
+
+// evictLRULocked removes the least-recently-used entry from the map and
+// returns it so the caller can close its connection after releasing c.mu.
+// Callers must hold c.mu.
+func (c *dbCache) evictLRULocked() *cacheEntry {
+	var oldestKey string
+	var oldest int64
+	for key, entry := range c.dbs {
+		used := entry.lastUsed.Load()
+		if oldestKey == "" || used < oldest {
+			oldestKey, oldest = key, used
+		}
+	}
+	if oldestKey == "" {
+		return nil
+	}
+	victim := c.dbs[oldestKey]
+	delete(c.dbs, oldestKey)
+	return victim
+}
+
+// get returns a live *sql.DB for key, reusing and re-validating a cached
+// pool if one exists. ctx bounds how long the caller is willing to wait for
+// a ping to a target that's slow or unreachable; it's always the probe
+// request's own context, so a wedged target fails that one scrape instead
+// of hanging the shared cache.
+func (c *dbCache) get(ctx context.Context, key, connStr string) (*sql.DB, error) {
+	c.mu.Lock()
+	entry, ok := c.dbs[key]
+	if !ok {
+		if len(c.dbs) >= *probeMaxTargets {
+			if victim := c.evictLRULocked(); victim != nil {
+				// Closed below, outside c.mu, in case the victim is mid-dial.
+				defer func() {
+					victim.mu.Lock()
+					defer victim.mu.Unlock()
+					if victim.db != nil {
+						victim.db.Close()
+					}
+				}()
+			}
+		}
+		entry = &cacheEntry{}
+		c.dbs[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	pingCtx, cancel := context.WithTimeout(ctx, *probeDialTimeout)
+	defer cancel()
+
+	if entry.db != nil {
+		if err := entry.db.PingContext(pingCtx); err == nil {
+			entry.lastUsed.Store(time.Now().UnixNano())
+			return entry.db, nil
+		}
+		entry.db.Close()
+		entry.db = nil
+	}
+
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(pingCtx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	entry.db = db
+	entry.lastUsed.Store(time.Now().UnixNano())
+	return db, nil
+}
+
+// buildProbeDSN assembles a libpq connection string for the given target
+// ("host:port") using the credentials and parameters from the named auth
+// module. Every value is quoted and escaped per libpq's connstring rules
+// (and host/port are additionally validated) so that a caller-controlled
+// target can never inject extra keywords (e.g. a second "host=" or
+// "sslmode=") into the DSN.
+func buildProbeDSN(target string, mod AuthModule) (string, error) {
+	host, port, err := splitHostPort(target)
+	if err != nil {
+		return "", err
+	}
+	if err := validateHostOrPort(host); err != nil {
+		return "", fmt.Errorf("invalid target %q: host %w", target, err)
+	}
+	if err := validateHostOrPort(port); err != nil {
+		return "", fmt.Errorf("invalid target %q: port %w", target, err)
+	}
+
+	sslmode := mod.SSLMode
+	if sslmode == "" {
+		sslmode = "require"
+	}
+
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s sslmode=%s",
+		quoteConnValue(host), quoteConnValue(port), quoteConnValue(mod.Username), quoteConnValue(mod.Password), quoteConnValue(sslmode))
+	for k, v := range mod.Params {
+		dsn += fmt.Sprintf(" %s=%s", k, quoteConnValue(v))
+	}
+	return dsn, nil
+}
+
+func splitHostPort(target string) (host, port string, err error) {
+	host, port, err = net.SplitHostPort(target)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid target %q, expected host:port: %w", target, err)
+	}
+	return host, port, nil
+}
+
+// validateHostOrPort rejects characters that have no legitimate place in a
+// hostname, IP literal, or port number, so a crafted target can't smuggle a
+// connstring keyword past quoteConnValue via a semantically-odd but
+// technically-quotable value (e.g. embedded control characters).
+func validateHostOrPort(s string) error {
+	if s == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.' || r == '-' || r == ':' || r == '_':
+		default:
+			return fmt.Errorf("contains disallowed character %q", r)
+		}
+	}
+	return nil
+}
+
+// quoteConnValue wraps v in single quotes and backslash-escapes any
+// backslash or single quote inside it, per libpq's connstring syntax
+// (https://www.postgresql.org/docs/current/libpq-connect.html#LIBPQ-CONNSTRING).
+// Quoting every value unconditionally means a value containing spaces,
+// "=", or other keyword-looking content is always treated as data, never as
+// the start of a new key=value pair.
+func quoteConnValue(v string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range v {
+		if r == '\\' || r == '\'' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// probeHandler returns an http.HandlerFunc implementing the Prometheus
+// multi-target exporter pattern: each request scrapes a single target named
+// by the "target" query parameter, authenticating with the auth module named
+// by "auth_module", running the configured query set (cfg.Queries) against
+// it, and returning metrics for that target alone using a fresh registry so
+// results from different targets never mix.
+func probeHandler(cfg *Config, cache *dbCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			http.Error(w, "target parameter is required", http.StatusBadRequest)
+			return
+		}
+
+		authModuleName := r.URL.Query().Get("auth_module")
+		mod, ok := cfg.AuthModules[authModuleName]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown auth_module %q", authModuleName), http.StatusBadRequest)
+			return
+		}
+
+		dsn, err := buildProbeDSN(target, mod)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		db, err := cache.get(r.Context(), authModuleName+"/"+target, dsn)
+		if err != nil {
+			log.Printf("ERROR: probe: could not connect to target %q: %v", target, err)
+			http.Error(w, fmt.Sprintf("could not connect to target: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Use a throwaway registry scoped to this single request so that
+		// labels and metric values from one target can never bleed into
+		// another target's scrape.
+		reg := prometheus.NewRegistry()
+
+		for _, def := range cfg.Queries {
+			vecs, err := buildQueryVecs(def)
+			if err != nil {
+				log.Printf("ERROR: probe: skipping invalid query %q: %v", def.Name, err)
+				continue
+			}
+			qctx, cancel := context.WithTimeout(r.Context(), def.timeout())
+			err = runQuery(qctx, db, def, vecs)
+			cancel()
+			if err != nil {
+				log.Printf("ERROR: probe: query %q against target %q failed: %v", def.Name, target, err)
+				continue
+			}
+			for _, v := range vecs {
+				reg.MustRegister(v)
+			}
+		}
+
+		promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}
+}
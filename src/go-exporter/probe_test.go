@@ -0,0 +1,113 @@
+// src/go-exporter/probe_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateHostOrPort(t *testing.T) {
+	cases := []struct {
+		name    string
+		in      string
+		wantErr bool
+	}{
+		{"hostname", "db.example.com", false},
+		{"ipv4 literal", "10.0.0.5", false},
+		{"port", "5432", false},
+		{"underscore", "my_host", false},
+		{"empty is an error", "", true},
+		{"embedded space is an error", "evil host", true},
+		{"embedded equals is an error", "sslmode=disable", true},
+		{"embedded single quote is an error", "host'", true},
+		{"embedded backslash is an error", `host\`, true},
+		{"embedded semicolon is an error", "host;rm", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateHostOrPort(tc.in)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("validateHostOrPort(%q) error = %v, wantErr %v", tc.in, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestQuoteConnValue(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain value", "rds_prod", `'rds_prod'`},
+		{"embedded single quote is escaped", `o'brien`, `'o\'brien'`},
+		{"embedded backslash is escaped", `back\slash`, `'back\\slash'`},
+		{"value that looks like another keyword stays data", "sslmode=disable", `'sslmode=disable'`},
+		{"empty value", "", `''`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := quoteConnValue(tc.in); got != tc.want {
+				t.Errorf("quoteConnValue(%q) = %s, want %s", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBuildProbeDSN(t *testing.T) {
+	mod := AuthModule{Username: "ro_user", Password: "p@ss", SSLMode: "verify-full"}
+
+	t.Run("valid target produces a fully quoted DSN", func(t *testing.T) {
+		dsn, err := buildProbeDSN("db.example.com:5432", mod)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, want := range []string{"host='db.example.com'", "port='5432'", "user='ro_user'", "password='p@ss'", "sslmode='verify-full'"} {
+			if !strings.Contains(dsn, want) {
+				t.Errorf("dsn %q missing %q", dsn, want)
+			}
+		}
+	})
+
+	t.Run("target smuggling a second host= keyword is rejected", func(t *testing.T) {
+		_, err := buildProbeDSN("x sslmode=disable host=attacker.evil.com:5432", mod)
+		if err == nil {
+			t.Fatal("expected an error for a target embedding extra connstring keywords, got nil")
+		}
+	})
+
+	t.Run("target missing a port is rejected", func(t *testing.T) {
+		_, err := buildProbeDSN("db.example.com", mod)
+		if err == nil {
+			t.Fatal("expected an error for a target without a port, got nil")
+		}
+	})
+
+	t.Run("target with an empty host is rejected", func(t *testing.T) {
+		_, err := buildProbeDSN(":5432", mod)
+		if err == nil {
+			t.Fatal("expected an error for a target with an empty host, got nil")
+		}
+	})
+
+	t.Run("a credential containing a quote is escaped, not broken out of", func(t *testing.T) {
+		hostile := AuthModule{Username: `ro_user' sslmode=disable --`, Password: "p"}
+		dsn, err := buildProbeDSN("db.example.com:5432", hostile)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(dsn, `user='ro_user\' sslmode=disable --'`) {
+			t.Errorf("dsn %q did not safely escape the hostile username", dsn)
+		}
+	})
+
+	t.Run("sslmode defaults to require when unset", func(t *testing.T) {
+		dsn, err := buildProbeDSN("db.example.com:5432", AuthModule{Username: "u", Password: "p"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(dsn, "sslmode='require'") {
+			t.Errorf("dsn %q missing default sslmode", dsn)
+		}
+	})
+}
@@ -0,0 +1,248 @@
+// src/go-exporter/queries.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Default cadence and timeout applied to a query that doesn't set its own.
+const (
+	defaultQueryInterval = 30 * time.Second
+	defaultQueryTimeout  = 5 * time.Second
+)
+
+// QueryDef describes one user-defined query loaded from the config file's
+// "queries" section: what metric(s) it produces and how often to run it.
+//
+// Each row returned by SQL becomes one observation. Columns named in Labels
+// become label values; columns named in Values become metric values. With a
+// single value column the metric is named Name; with more than one, each
+// column gets its own metric named Name + "_" + column, all sharing Labels.
+//
+// "histogram" is deliberately not a supported Type: a histogram needs a
+// bucketed distribution of observations, but a query here produces at most
+// one row per label set per scrape, i.e. one pre-aggregated number — there's
+// no way to recover bucket boundaries from that. Rather than fake it with a
+// single-bucket histogram, unsupported types are rejected outright; if a
+// real histogram is needed, postgres_exporter's own convention (separate
+// "bucket", "sum", and "count" columns assembled into a HistogramVec) would
+// be the place to add it.
+//
+// The same definition is used both for queries run continuously against the
+// exporter's own target (queryCollector) and for queries run once per
+// request against a /probe target.
+type QueryDef struct {
+	Name     string   `yaml:"name"`
+	Help     string   `yaml:"help"`
+	Type     string   `yaml:"type"` // "gauge" or "counter"; defaults to "gauge". "histogram" is rejected, see above.
+	Labels   []string `yaml:"labels"`
+	Values   []string `yaml:"values"`
+	SQL      string   `yaml:"sql"`
+	Interval string   `yaml:"interval"`
+	Timeout  string   `yaml:"timeout"`
+}
+
+func (q QueryDef) interval() time.Duration {
+	if d, err := time.ParseDuration(q.Interval); err == nil && d > 0 {
+		return d
+	}
+	return defaultQueryInterval
+}
+
+func (q QueryDef) timeout() time.Duration {
+	if d, err := time.ParseDuration(q.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return defaultQueryTimeout
+}
+
+// buildQueryVecs validates def and builds one metric vector per value
+// column, keyed by column name. It doesn't touch the database.
+func buildQueryVecs(def QueryDef) (map[string]*prometheus.GaugeVec, error) {
+	switch def.Type {
+	case "gauge", "counter", "":
+	case "histogram":
+		return nil, fmt.Errorf("query %q: type \"histogram\" is not supported (a query produces one pre-aggregated number per row, not a bucketed distribution); use \"gauge\" or \"counter\"", def.Name)
+	default:
+		return nil, fmt.Errorf("query %q: unsupported type %q (want gauge or counter)", def.Name, def.Type)
+	}
+	if len(def.Values) == 0 {
+		return nil, fmt.Errorf("query %q: at least one value column is required", def.Name)
+	}
+
+	vecs := make(map[string]*prometheus.GaugeVec, len(def.Values))
+	for _, col := range def.Values {
+		name := def.Name
+		if len(def.Values) > 1 {
+			name = def.Name + "_" + col
+		}
+		// A counter produced by a query is really just a number read back
+		// from the database (e.g. a running total column), so it's exposed
+		// as a GaugeVec regardless of the declared type: Prometheus counters
+		// must only ever increase from this process's point of view, which
+		// a query-derived value cannot promise.
+		vecs[col] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: name,
+			Help: def.Help,
+		}, def.Labels)
+	}
+	return vecs, nil
+}
+
+// queryCollector is a prometheus.Collector backed by a single user-defined
+// query. It holds one vector per value column and refreshes them on its own
+// ticker, independent of every other query's cadence.
+type queryCollector struct {
+	def  QueryDef
+	db   querier
+	vecs map[string]*prometheus.GaugeVec // keyed by value column; used for gauge and counter alike
+}
+
+// newQueryCollector builds the metric vector(s) for def without touching the
+// database; call Run to start refreshing them.
+func newQueryCollector(def QueryDef, db querier) (*queryCollector, error) {
+	vecs, err := buildQueryVecs(def)
+	if err != nil {
+		return nil, err
+	}
+	return &queryCollector{def: def, db: db, vecs: vecs}, nil
+}
+
+func (qc *queryCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, v := range qc.vecs {
+		v.Describe(ch)
+	}
+}
+
+func (qc *queryCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, v := range qc.vecs {
+		v.Collect(ch)
+	}
+}
+
+// Run executes the query on its own ticker until ctx is canceled, updating
+// the collector's metric vectors after each successful run.
+func (qc *queryCollector) Run(ctx context.Context) {
+	ticker := time.NewTicker(qc.def.interval())
+	defer ticker.Stop()
+
+	qc.refresh(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			qc.refresh(ctx)
+		}
+	}
+}
+
+func (qc *queryCollector) refresh(ctx context.Context) {
+	qctx, cancel := context.WithTimeout(ctx, qc.def.timeout())
+	defer cancel()
+
+	for _, v := range qc.vecs {
+		v.Reset()
+	}
+	if err := runQuery(qctx, qc.db, qc.def, qc.vecs); err != nil {
+		log.Printf("ERROR: query %q failed: %v", qc.def.Name, err)
+	}
+}
+
+// runQuery executes def.SQL against db, starting a trace span for exemplar
+// support, and populates vecs (keyed by value column, as built by
+// buildQueryVecs) from the result rows. Callers own resetting vecs first if
+// they want stale label sets cleared.
+func runQuery(ctx context.Context, db querier, def QueryDef, vecs map[string]*prometheus.GaugeVec) error {
+	ctx, span := tracer.Start(ctx, "query."+def.Name)
+	defer span.End()
+	var traceID string
+	if sc := span.SpanContext(); sc.IsValid() {
+		traceID = sc.TraceID().String()
+	}
+
+	rows, err := instrumentedQuery(ctx, db, def.Name, def.SQL, traceID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("reading columns: %w", err)
+	}
+	colIdx := make(map[string]int, len(cols))
+	for i, c := range cols {
+		colIdx[c] = i
+	}
+
+	for rows.Next() {
+		dest := make([]interface{}, len(cols))
+		raw := make([]sql.RawBytes, len(cols))
+		for i := range dest {
+			dest[i] = &raw[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("scanning row: %w", err)
+		}
+
+		labelValues, values, issues, err := extractLabelsAndValues(colIdx, raw, def.Labels, def.Values)
+		if err != nil {
+			return err
+		}
+		for _, issue := range issues {
+			log.Printf("ERROR: query %q: %v", def.Name, issue)
+		}
+		for col, val := range values {
+			vecs[col].WithLabelValues(labelValues...).Set(val)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterating rows: %w", err)
+	}
+	return nil
+}
+
+// extractLabelsAndValues reads labels and values out of one result row
+// (raw, indexed by colIdx) for a query. A missing label column is fatal
+// (err is non-nil, since the row can't be labeled at all); a missing value
+// column or an unparsable value is reported via issues but doesn't prevent
+// the other value columns in the row from being used.
+func extractLabelsAndValues(colIdx map[string]int, raw []sql.RawBytes, labels, values []string) (labelValues []string, vals map[string]float64, issues []error, err error) {
+	labelValues = make([]string, len(labels))
+	for i, l := range labels {
+		idx, ok := colIdx[l]
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("label column %q not in result set", l)
+		}
+		labelValues[i] = string(raw[idx])
+	}
+
+	vals = make(map[string]float64, len(values))
+	for _, col := range values {
+		idx, ok := colIdx[col]
+		if !ok {
+			issues = append(issues, fmt.Errorf("value column %q not in result set", col))
+			continue
+		}
+		v, perr := parseMetricValue(raw[idx])
+		if perr != nil {
+			issues = append(issues, fmt.Errorf("parsing value column %q: %w", col, perr))
+			continue
+		}
+		vals[col] = v
+	}
+	return labelValues, vals, issues, nil
+}
+
+func parseMetricValue(raw sql.RawBytes) (float64, error) {
+	var f float64
+	_, err := fmt.Sscanf(string(raw), "%g", &f)
+	return f, err
+}
@@ -0,0 +1,189 @@
+// src/go-exporter/queries_test.go
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildQueryVecs(t *testing.T) {
+	t.Run("gauge, counter, and unset type are accepted", func(t *testing.T) {
+		for _, typ := range []string{"gauge", "counter", ""} {
+			def := QueryDef{Name: "q", Values: []string{"v"}, Type: typ}
+			if _, err := buildQueryVecs(def); err != nil {
+				t.Errorf("buildQueryVecs(type=%q) unexpected error: %v", typ, err)
+			}
+		}
+	})
+
+	t.Run("histogram is explicitly rejected", func(t *testing.T) {
+		def := QueryDef{Name: "q", Values: []string{"v"}, Type: "histogram"}
+		_, err := buildQueryVecs(def)
+		if err == nil {
+			t.Fatal("expected an error for type \"histogram\", got nil")
+		}
+		if !strings.Contains(err.Error(), "not supported") {
+			t.Errorf("error %q should explain that histogram is unsupported, not just reject it", err)
+		}
+	})
+
+	t.Run("unrecognized type is rejected", func(t *testing.T) {
+		def := QueryDef{Name: "q", Values: []string{"v"}, Type: "summary"}
+		if _, err := buildQueryVecs(def); err == nil {
+			t.Fatal("expected an error for an unrecognized type, got nil")
+		}
+	})
+
+	t.Run("at least one value column is required", func(t *testing.T) {
+		def := QueryDef{Name: "q"}
+		if _, err := buildQueryVecs(def); err == nil {
+			t.Fatal("expected an error when Values is empty, got nil")
+		}
+	})
+
+	t.Run("multiple value columns get per-column metric names", func(t *testing.T) {
+		def := QueryDef{Name: "q", Values: []string{"a", "b"}}
+		vecs, err := buildQueryVecs(def)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(vecs) != 2 {
+			t.Fatalf("expected 2 vecs, got %d", len(vecs))
+		}
+		if _, ok := vecs["a"]; !ok {
+			t.Errorf("missing vec for column %q", "a")
+		}
+		if _, ok := vecs["b"]; !ok {
+			t.Errorf("missing vec for column %q", "b")
+		}
+	})
+}
+
+func TestQueryDefInterval(t *testing.T) {
+	cases := []struct {
+		name  string
+		field string
+		want  time.Duration
+	}{
+		{"valid duration", "45s", 45 * time.Second},
+		{"empty falls back to default", "", defaultQueryInterval},
+		{"unparsable falls back to default", "not-a-duration", defaultQueryInterval},
+		{"zero falls back to default", "0s", defaultQueryInterval},
+		{"negative falls back to default", "-5s", defaultQueryInterval},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			def := QueryDef{Interval: tc.field}
+			if got := def.interval(); got != tc.want {
+				t.Errorf("interval() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestQueryDefTimeout(t *testing.T) {
+	cases := []struct {
+		name  string
+		field string
+		want  time.Duration
+	}{
+		{"valid duration", "2s", 2 * time.Second},
+		{"empty falls back to default", "", defaultQueryTimeout},
+		{"unparsable falls back to default", "nope", defaultQueryTimeout},
+		{"zero falls back to default", "0s", defaultQueryTimeout},
+		{"negative falls back to default", "-1s", defaultQueryTimeout},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			def := QueryDef{Timeout: tc.field}
+			if got := def.timeout(); got != tc.want {
+				t.Errorf("timeout() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseMetricValue(t *testing.T) {
+	cases := []struct {
+		name    string
+		raw     string
+		want    float64
+		wantErr bool
+	}{
+		{"integer", "42", 42, false},
+		{"negative float", "-3.14", -3.14, false},
+		{"scientific notation", "1.5e3", 1500, false},
+		{"empty is an error", "", 0, true},
+		{"non-numeric is an error", "not-a-number", 0, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseMetricValue(sql.RawBytes(tc.raw))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("parseMetricValue(%q) error = %v, wantErr %v", tc.raw, err, tc.wantErr)
+			}
+			if !tc.wantErr && got != tc.want {
+				t.Errorf("parseMetricValue(%q) = %v, want %v", tc.raw, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtractLabelsAndValues(t *testing.T) {
+	colIdx := map[string]int{"status": 0, "count": 1}
+
+	t.Run("normal row", func(t *testing.T) {
+		raw := []sql.RawBytes{sql.RawBytes("ok"), sql.RawBytes("7")}
+		labelValues, vals, issues, err := extractLabelsAndValues(colIdx, raw, []string{"status"}, []string{"count"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(issues) != 0 {
+			t.Fatalf("unexpected issues: %v", issues)
+		}
+		if want := []string{"ok"}; len(labelValues) != 1 || labelValues[0] != want[0] {
+			t.Errorf("labelValues = %v, want %v", labelValues, want)
+		}
+		if vals["count"] != 7 {
+			t.Errorf("vals[count] = %v, want 7", vals["count"])
+		}
+	})
+
+	t.Run("missing label column is fatal", func(t *testing.T) {
+		raw := []sql.RawBytes{sql.RawBytes("ok"), sql.RawBytes("7")}
+		_, _, _, err := extractLabelsAndValues(colIdx, raw, []string{"region"}, []string{"count"})
+		if err == nil {
+			t.Fatal("expected an error for a missing label column, got nil")
+		}
+	})
+
+	t.Run("missing value column is a non-fatal issue", func(t *testing.T) {
+		raw := []sql.RawBytes{sql.RawBytes("ok"), sql.RawBytes("7")}
+		_, vals, issues, err := extractLabelsAndValues(colIdx, raw, []string{"status"}, []string{"missing_col"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(issues) != 1 {
+			t.Fatalf("expected 1 issue, got %d: %v", len(issues), issues)
+		}
+		if _, ok := vals["missing_col"]; ok {
+			t.Errorf("vals should not contain missing_col, got %v", vals)
+		}
+	})
+
+	t.Run("unparsable value is a non-fatal issue", func(t *testing.T) {
+		raw := []sql.RawBytes{sql.RawBytes("ok"), sql.RawBytes("not-a-number")}
+		_, vals, issues, err := extractLabelsAndValues(colIdx, raw, []string{"status"}, []string{"count"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(issues) != 1 {
+			t.Fatalf("expected 1 issue, got %d: %v", len(issues), issues)
+		}
+		if _, ok := vals["count"]; ok {
+			t.Errorf("vals should not contain count, got %v", vals)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+// src/go-exporter/tracing.go
+package main
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer generates the per-scrape trace IDs attached to query duration
+// exemplars. It's a no-op tracer (valid, but produces no spans or IDs)
+// until initTracing configures a real OTLP exporter.
+var tracer trace.Tracer = otel.Tracer("telemetryhub/go-exporter")
+
+// initTracing wires up an OTLP/gRPC trace exporter if OTEL_EXPORTER_OTLP_ENDPOINT
+// is set, so operators can click from a Grafana latency spike on
+// telemetryhub_query_duration_seconds through to the exact trace. If the env
+// var is unset, tracer stays a no-op and exemplars are simply omitted.
+func initTracing(ctx context.Context) (shutdown func(context.Context) error, err error) {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exp, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(endpoint), otlptracegrpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx, resource.WithAttributes(semconv.ServiceName("telemetryhub-go-exporter")))
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	tracer = tp.Tracer("telemetryhub/go-exporter")
+	return tp.Shutdown, nil
+}